@@ -9,8 +9,11 @@ import (
 	"database/sql"
 	"database/sql/driver"
 	"fmt"
+	"math"
 	"reflect"
+	"strconv"
 	s "strings"
+	"sync"
 	"time"
 )
 
@@ -27,6 +30,80 @@ type MapDecoder interface {
 	MapDecode(interface{}) error
 }
 
+// TypeEncoderFunc converts a value of a registered type into the
+// representation MapTags/MapFields store for it.
+type TypeEncoderFunc func(reflect.Value) (interface{}, error)
+
+// TypeDecoderFunc decodes a raw value into a settable reflect.Value of a
+// registered type.
+type TypeDecoderFunc func(interface{}, reflect.Value) error
+
+// Codec is a registry of per-type encoders/decoders for third-party types
+// that smapping does not own (uuid.UUID, decimal.Decimal, net.IP,
+// sql.NullString, protobuf timestamps, ...), so callers don't have to wrap
+// them or add MapEncode/MapDecode methods. The package-level
+// RegisterTypeEncoder/RegisterTypeDecoder register against a shared default
+// Codec consulted by getValTag and SetFieldFromTag ahead of the built-in
+// Time/MapEncoder/MapDecoder handling. Use NewCodec for a registry scoped to
+// a single caller instead of the global default.
+type Codec struct {
+	encoders sync.Map // reflect.Type -> TypeEncoderFunc
+	decoders sync.Map // reflect.Type -> TypeDecoderFunc
+}
+
+// NewCodec returns an empty Codec whose registrations are independent of
+// the package-level default.
+func NewCodec() *Codec {
+	return &Codec{}
+}
+
+// RegisterTypeEncoder registers fn as the encoder for values of type t.
+func (c *Codec) RegisterTypeEncoder(t reflect.Type, fn TypeEncoderFunc) {
+	c.encoders.Store(t, fn)
+}
+
+// RegisterTypeDecoder registers fn as the decoder for values of type t.
+func (c *Codec) RegisterTypeDecoder(t reflect.Type, fn TypeDecoderFunc) {
+	c.decoders.Store(t, fn)
+}
+
+// Encode runs the registered encoder for v's type, if any, reporting
+// whether a match was found.
+func (c *Codec) Encode(v reflect.Value) (val interface{}, handled bool, err error) {
+	fn, ok := c.encoders.Load(v.Type())
+	if !ok {
+		return nil, false, nil
+	}
+	val, err = fn.(TypeEncoderFunc)(v)
+	return val, true, err
+}
+
+// Decode runs the registered decoder for target's type, if any, reporting
+// whether a match was found.
+func (c *Codec) Decode(value interface{}, target reflect.Value) (handled bool, err error) {
+	fn, ok := c.decoders.Load(target.Type())
+	if !ok {
+		return false, nil
+	}
+	return true, fn.(TypeDecoderFunc)(value, target)
+}
+
+var defaultCodec = NewCodec()
+
+// RegisterTypeEncoder registers fn as the encoder for values of type t on
+// the package-level default Codec, consulted by MapTags/MapFields (via
+// getValTag) ahead of the built-in time.Time/MapEncoder handling.
+func RegisterTypeEncoder(t reflect.Type, fn TypeEncoderFunc) {
+	defaultCodec.RegisterTypeEncoder(t, fn)
+}
+
+// RegisterTypeDecoder registers fn as the decoder for values of type t on
+// the package-level default Codec, consulted by FillStruct/FillStructByTags
+// (via SetFieldFromTag) ahead of the built-in time.Time/MapDecoder handling.
+func RegisterTypeDecoder(t reflect.Type, fn TypeDecoderFunc) {
+	defaultCodec.RegisterTypeDecoder(t, fn)
+}
+
 var mapDecoderI = reflect.TypeOf((*MapDecoder)(nil)).Elem()
 
 func extractValue(x interface{}) reflect.Value {
@@ -62,6 +139,34 @@ func tagHead(tag string) string {
 	return s.Split(tag, ",")[0]
 }
 
+// tagOptions is the comma-separated modifiers following a tag's name, e.g.
+// "omitempty" in `json:"foo,omitempty"`. Mirrors encoding/json's tagOptions.
+type tagOptions string
+
+// parseTag splits a struct tag value into its name and modifiers, e.g.
+// `"foo,omitempty"` becomes ("foo", tagOptions("omitempty")).
+func parseTag(tag string) (string, tagOptions) {
+	name, opts, _ := s.Cut(tag, ",")
+	return name, tagOptions(opts)
+}
+
+// Contains reports whether optionName is one of the comma-separated
+// modifiers in o.
+func (o tagOptions) Contains(optionName string) bool {
+	if len(o) == 0 {
+		return false
+	}
+	opts := string(o)
+	for opts != "" {
+		var name string
+		name, opts, _ = s.Cut(opts, ",")
+		if name == optionName {
+			return true
+		}
+	}
+	return false
+}
+
 func isValueNil(v reflect.Value) bool {
 	for _, kind := range []reflect.Kind{
 		reflect.Ptr, reflect.Slice, reflect.Map,
@@ -80,7 +185,12 @@ func getValTag(fieldval reflect.Value, tag string) interface{} {
 	if isValueNil(fieldval) {
 		return nil
 	}
-	if fieldval.Type().Name() == "Time" ||
+	if val, ok, err := defaultCodec.Encode(fieldval); ok {
+		if err != nil {
+			return nil
+		}
+		return val
+	} else if fieldval.Type().Name() == "Time" ||
 		reflect.Indirect(fieldval).Type().Name() == "Time" {
 		resval = fieldval.Interface()
 	} else if typof := fieldval.Type(); typof.Implements(mapEncoderI) ||
@@ -121,6 +231,85 @@ func getValTag(fieldval reflect.Value, tag string) interface{} {
 	return resval
 }
 
+// cachedField is the memoized description of one exported struct field for
+// a given tag name: its index, name, tag head, omitempty/skip modifiers,
+// and whether it needs struct/time/MapEncoder/MapDecoder handling.
+type cachedField struct {
+	Index        int
+	Name         string
+	StructField  reflect.StructField
+	TagHead      string
+	HasTag       bool
+	OmitEmpty    bool
+	Skip         bool
+	IsStruct     bool
+	IsTime       bool
+	IsMapEncoder bool
+	IsMapDecoder bool
+}
+
+type structCacheKey struct {
+	typ reflect.Type
+	tag string
+}
+
+// structCache memoizes cachedFieldsFor's result per (type, tag name), since
+// MapTags/MapTagsWithDefault/MapTagsFlatten/populateMapFieldsTag/SQLScan
+// otherwise re-walk NumField()/Tag.Lookup on every call against the same
+// struct type, which is a measurable hot path (e.g. every row of a SQLScan
+// loop, or every item in a slice). Invalidation is unnecessary since Go
+// types are immutable at runtime.
+var structCache sync.Map // structCacheKey -> []cachedField
+
+func cachedFieldsFor(typ reflect.Type, tagname string) []cachedField {
+	key := structCacheKey{typ: typ, tag: tagname}
+	if v, ok := structCache.Load(key); ok {
+		return v.([]cachedField)
+	}
+	n := typ.NumField()
+	fields := make([]cachedField, 0, n)
+	for i := 0; i < n; i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		cf := cachedField{Index: i, Name: field.Name, StructField: field}
+		if tagname == "" {
+			cf.TagHead = field.Name
+			cf.HasTag = true
+		} else if tagvalue, ok := field.Tag.Lookup(tagname); ok {
+			name, opts := parseTag(tagvalue)
+			cf.TagHead = name
+			cf.HasTag = true
+			cf.OmitEmpty = opts.Contains("omitempty")
+			cf.Skip = name == "-" && opts == ""
+		}
+		ftype := field.Type
+		indirect := ftype
+		if indirect.Kind() == reflect.Ptr {
+			indirect = indirect.Elem()
+		}
+		cf.IsStruct = indirect.Kind() == reflect.Struct
+		cf.IsTime = isTime(ftype)
+		cf.IsMapEncoder = ftype.Implements(mapEncoderI) || reflect.PtrTo(ftype).Implements(mapEncoderI)
+		cf.IsMapDecoder = ftype.Implements(mapDecoderI) || reflect.PointerTo(ftype).Implements(mapDecoderI)
+		fields = append(fields, cf)
+	}
+	actual, _ := structCache.LoadOrStore(key, fields)
+	return actual.([]cachedField)
+}
+
+// ClearCache empties the reflection cache populated by MapTags and friends.
+// Exported for tests that need to observe fresh reflection results. Safe to
+// call concurrently with cache reads/writes: entries are deleted in place
+// rather than swapping out the package-level sync.Map.
+func ClearCache() {
+	structCache.Range(func(key, _ interface{}) bool {
+		structCache.Delete(key)
+		return true
+	})
+}
+
 /*
 MapTags maps the tag value of defined field tag name. This enable
 various field extraction that will be mapped to mapped interfaces{}.
@@ -131,18 +320,15 @@ func MapTags(x interface{}, tag string) Mapped {
 	if !value.IsValid() {
 		return nil
 	}
-	xtype := value.Type()
-	for i := 0; i < value.NumField(); i++ {
-		field := xtype.Field(i)
-		if field.PkgPath != "" {
+	for _, cf := range cachedFieldsFor(value.Type(), tag) {
+		if !cf.HasTag || cf.Skip {
 			continue
 		}
-		fieldval := value.Field(i)
-		if tag == "" {
-			result[field.Name] = getValTag(fieldval, tag)
-		} else if tagvalue, ok := field.Tag.Lookup(tag); ok {
-			result[tagHead(tagvalue)] = getValTag(fieldval, tag)
+		fieldval := value.Field(cf.Index)
+		if cf.OmitEmpty && fieldval.IsZero() {
+			continue
 		}
+		result[cf.TagHead] = getValTag(fieldval, tag)
 	}
 	return result
 }
@@ -158,62 +344,215 @@ func MapTagsWithDefault(x interface{}, tag string, defs ...string) Mapped {
 	if !value.IsValid() {
 		return nil
 	}
-	xtype := value.Type()
-	for i := 0; i < value.NumField(); i++ {
-		field := xtype.Field(i)
-		if field.PkgPath != "" {
+	typ := value.Type()
+	defByIndex := make([]map[int]cachedField, len(defs))
+	for i, deftag := range defs {
+		m := make(map[int]cachedField)
+		for _, cf := range cachedFieldsFor(typ, deftag) {
+			if cf.HasTag {
+				m[cf.Index] = cf
+			}
+		}
+		defByIndex[i] = m
+	}
+	for _, cf := range cachedFieldsFor(typ, tag) {
+		if cf.HasTag {
+			if cf.Skip {
+				continue
+			}
+			fieldval := value.Field(cf.Index)
+			if cf.OmitEmpty && fieldval.IsZero() {
+				continue
+			}
+			result[cf.TagHead] = getValTag(fieldval, tag)
 			continue
 		}
-		var (
-			tagval string
-			ok     bool
-		)
-		if tagval, ok = field.Tag.Lookup(tag); ok {
-			result[tagHead(tagval)] = getValTag(value.Field(i), tag)
-		} else {
-			for _, deftag := range defs {
-				if tagval, ok = field.Tag.Lookup(deftag); ok {
-					result[tagHead(tagval)] = getValTag(value.Field(i), deftag)
-					break // break from looping the defs
+		for i, m := range defByIndex {
+			if dcf, ok := m[cf.Index]; ok {
+				if dcf.Skip {
+					break
 				}
+				fieldval := value.Field(cf.Index)
+				if dcf.OmitEmpty && fieldval.IsZero() {
+					break
+				}
+				result[dcf.TagHead] = getValTag(fieldval, defs[i])
+				break // break from looping the defs
 			}
 		}
 	}
 	return result
 }
 
-// MapTagsFlatten is to flatten mapped object with specific tag. The limitation
-// of this flattening that it can't have duplicate tag name and it will give
-// incorrect result because the older value will be written with newer map field value.
-func MapTagsFlatten(x interface{}, tag string) Mapped {
-	result := make(Mapped)
-	value := extractValue(x)
+// FlattenOptions configures the dotted-path key composition used by
+// MapTagsFlattenOpts and FillStructInflateOpts.
+type FlattenOptions struct {
+	// Separator joins parent and child key segments, e.g. "." turns nested
+	// field tags "user"/"address"/"city" into "user.address.city".
+	// Defaults to "." when empty.
+	Separator string
+	// MaxDepth caps how many nested levels are traversed; 0 means unlimited.
+	MaxDepth int
+}
+
+func (o FlattenOptions) separator() string {
+	if o.Separator == "" {
+		return "."
+	}
+	return o.Separator
+}
+
+func joinFlattenKey(prefix, head, sep string) string {
+	if prefix == "" {
+		return head
+	}
+	return prefix + sep + head
+}
+
+func flattenTagsInto(result Mapped, value reflect.Value, tag, prefix string, opts FlattenOptions, depth int) error {
 	if !value.IsValid() {
 		return nil
 	}
-	xtype := value.Type()
-	for i := 0; i < value.NumField(); i++ {
+	if opts.MaxDepth > 0 && depth > opts.MaxDepth {
+		return fmt.Errorf("smapping: path %q exceeds max depth %d", prefix, opts.MaxDepth)
+	}
+	for _, cf := range cachedFieldsFor(value.Type(), tag) {
+		if cf.Skip {
+			continue
+		}
+		fieldval := value.Field(cf.Index)
+		isLeaf := !cf.IsStruct || cf.IsTime || cf.IsMapEncoder
+		if cf.HasTag && isLeaf {
+			if cf.OmitEmpty && fieldval.IsZero() {
+				continue
+			}
+			key := joinFlattenKey(prefix, cf.TagHead, opts.separator())
+			result[key] = getValTag(fieldval, tag)
+			continue
+		}
+		if isLeaf {
+			continue
+		}
+		nextPrefix := prefix
+		if cf.HasTag {
+			nextPrefix = joinFlattenKey(prefix, cf.TagHead, opts.separator())
+		}
+		if err := flattenTagsInto(result, reflect.Indirect(fieldval), tag, nextPrefix, opts, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MapTagsFlattenOpts flattens mapped object with specific tag into a
+// single-level Mapped whose keys are the dotted path of nested field tags
+// (e.g. "user.address.city"), composed and split using opts.Separator.
+// opts.MaxDepth, when non-zero, caps how many nested levels are traversed;
+// a subtree deeper than opts.MaxDepth returns an error rather than silently
+// dropping its fields, matching FillStructInflateOpts' behavior on the same
+// option.
+func MapTagsFlattenOpts(x interface{}, tag string, opts FlattenOptions) (Mapped, error) {
+	result := make(Mapped)
+	if err := flattenTagsInto(result, extractValue(x), tag, "", opts, 0); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// MapTagsFlatten is to flatten mapped object with specific tag, composing
+// nested field tags into dotted-path keys (e.g. "user.address.city") using
+// "." as the default separator. It is a thin wrapper over
+// MapTagsFlattenOpts with default (unlimited-depth) options; use
+// MapTagsFlattenOpts directly to configure the separator or a max-depth
+// guard.
+func MapTagsFlatten(x interface{}, tag string) Mapped {
+	result, _ := MapTagsFlattenOpts(x, tag, FlattenOptions{})
+	return result
+}
+
+func setFieldFromPath(obj interface{}, tag string, path []string, value interface{}) error {
+	rObjVal := extractValue(obj)
+	if !rObjVal.IsValid() {
+		return fmt.Errorf("smapping: invalid destination for path %q", s.Join(path, "."))
+	}
+	if len(path) == 1 {
+		mapf := make(map[string]reflect.StructField)
+		if tag != "" {
+			populateMapFieldsTag(mapf, tag, rObjVal)
+		}
+		_, err := setFieldFromTag(rObjVal, tag, path[0], value, mapf)
+		return err
+	}
+	xtype := rObjVal.Type()
+	for i := 0; i < rObjVal.NumField(); i++ {
 		field := xtype.Field(i)
 		if field.PkgPath != "" {
 			continue
 		}
-		fieldval := value.Field(i)
-		isStruct := reflect.Indirect(fieldval).Type().Kind() == reflect.Struct
-		if tagvalue, ok := field.Tag.Lookup(tag); ok && !isStruct {
-			key := tagHead(tagvalue)
-			result[key] = fieldval.Interface()
+		head := field.Name
+		if tag != "" {
+			tagvalue, ok := field.Tag.Lookup(tag)
+			if !ok {
+				continue
+			}
+			head = tagHead(tagvalue)
+		}
+		if head != path[0] {
+			continue
+		}
+		fieldval := rObjVal.Field(i)
+		if fieldval.Kind() == reflect.Ptr {
+			if fieldval.IsNil() {
+				fieldval.Set(reflect.New(fieldval.Type().Elem()))
+			}
+			return setFieldFromPath(fieldval.Interface(), tag, path[1:], value)
+		}
+		if fieldval.Kind() != reflect.Struct {
+			return fmt.Errorf("smapping: field %q is not a struct, cannot hold nested path %q", path[0], s.Join(path, "."))
+		}
+		return setFieldFromPath(fieldval.Addr().Interface(), tag, path[1:], value)
+	}
+	return fmt.Errorf("smapping: no field for path segment %q", path[0])
+}
+
+// FillStructInflateOpts fills obj from mapped, the inverse of
+// MapTagsFlattenOpts: each key in mapped is a dotted path (e.g.
+// "user.address.city", split on opts.Separator) that is walked into nested
+// struct/pointer fields named by tag, creating pointer targets via
+// reflect.New as needed.
+func FillStructInflateOpts(obj interface{}, mapped Mapped, tag string, opts FlattenOptions) error {
+	errmsg := ""
+	for k, v := range mapped {
+		if v == nil {
 			continue
 		}
-		fieldval = reflect.Indirect(fieldval)
-		if !isStruct {
+		path := s.Split(k, opts.separator())
+		if opts.MaxDepth > 0 && len(path) > opts.MaxDepth+1 {
+			if errmsg != "" {
+				errmsg += ","
+			}
+			errmsg += fmt.Sprintf("smapping: path %q exceeds max depth %d", k, opts.MaxDepth)
 			continue
 		}
-		nests := MapTagsFlatten(fieldval, tag)
-		for k, v := range nests {
-			result[k] = v
+		if err := setFieldFromPath(obj, tag, path, v); err != nil {
+			if errmsg != "" {
+				errmsg += ","
+			}
+			errmsg += err.Error()
 		}
 	}
-	return result
+	if errmsg != "" {
+		return fmt.Errorf(errmsg)
+	}
+	return nil
+}
+
+// FillStructInflate fills obj from a flat Mapped whose keys are dotted
+// paths (e.g. "user.address.city"), using "." as the default separator.
+// It is the inverse of MapTagsFlatten; use FillStructInflateOpts to
+// configure the separator or a max-depth guard.
+func FillStructInflate(obj interface{}, mapped Mapped, tag string) error {
+	return FillStructInflateOpts(obj, mapped, tag, FlattenOptions{})
 }
 
 func isTime(typ reflect.Type) bool {
@@ -269,6 +608,88 @@ func fillMapIter(vfield, res reflect.Value, val *reflect.Value, tagname string)
 	return nil
 }
 
+// isMapFieldDest reports whether fieldType (or the type it points to) is a
+// map keyed by string, e.g. map[string]T or *map[string]T.
+func isMapFieldDest(fieldType reflect.Type) bool {
+	if fieldType.Kind() == reflect.Ptr {
+		fieldType = fieldType.Elem()
+	}
+	return fieldType.Kind() == reflect.Map && fieldType.Key().Kind() == reflect.String
+}
+
+// decodeMapElem decodes a single raw value into elemType, the element type
+// of a map[string]T destination field. It supports scalar T, struct T (via
+// FillStructByTags), pointer T, and nested map T.
+func decodeMapElem(elemType reflect.Type, value interface{}, tagname string) (reflect.Value, error) {
+	switch elemType.Kind() {
+	case reflect.Map:
+		return decodeMapField(elemType, value, tagname)
+	case reflect.Ptr:
+		inner, err := decodeMapElem(elemType.Elem(), value, tagname)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		ptr := reflect.New(elemType.Elem())
+		ptr.Elem().Set(inner)
+		return ptr, nil
+	case reflect.Struct:
+		var m Mapped
+		switch src := value.(type) {
+		case Mapped:
+			m = src
+		case map[string]interface{}:
+			m = Mapped(src)
+		default:
+			return reflect.Value{}, fmt.Errorf("cannot decode %T into struct %s", value, elemType)
+		}
+		res := reflect.New(elemType)
+		if err := FillStructByTags(res.Interface(), m, tagname); err != nil {
+			return reflect.Value{}, err
+		}
+		return res.Elem(), nil
+	default:
+		rv := reflect.ValueOf(value)
+		if !rv.IsValid() {
+			return reflect.Value{}, fmt.Errorf("nil value for map element of type %s", elemType)
+		}
+		if rv.Type() == elemType {
+			return rv, nil
+		}
+		if rv.CanConvert(elemType) {
+			return rv.Convert(elemType), nil
+		}
+		return reflect.Value{}, fmt.Errorf("cannot decode %T into %s", value, elemType)
+	}
+}
+
+// decodeMapField decodes value (a Mapped or map[string]interface{}) into a
+// new map[string]T of fieldType, recursively decoding each entry.
+func decodeMapField(fieldType reflect.Type, value interface{}, tagname string) (reflect.Value, error) {
+	var keys []string
+	var lookup map[string]interface{}
+	switch src := value.(type) {
+	case Mapped:
+		lookup = src
+	case map[string]interface{}:
+		lookup = src
+	default:
+		return reflect.Value{}, fmt.Errorf("cannot decode %T into map field", value)
+	}
+	for k := range lookup {
+		keys = append(keys, k)
+	}
+	result := reflect.MakeMapWithSize(fieldType, len(keys))
+	elemType := fieldType.Elem()
+	for _, k := range keys {
+		elemVal, err := decodeMapElem(elemType, lookup[k], tagname)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("map key %q: %s", k, err.Error())
+		}
+		result.SetMapIndex(reflect.ValueOf(k), elemVal)
+	}
+	return result, nil
+}
+
 func fillTime(vfield reflect.Value, val *reflect.Value) error {
 	if (*val).Type().Name() == "string" {
 		newval, err := handleTime(time.RFC3339, val.String(), vfield.Type())
@@ -366,29 +787,275 @@ func fillSlice(res reflect.Value, val *reflect.Value, tagname string) error {
 }
 
 func populateMapFieldsTag(mapfield map[string]reflect.StructField, tagname string, obj interface{}) {
+	if tagname == "" {
+		return
+	}
 	sval := extractValue(obj)
-	stype := sval.Type()
-	for i := 0; i < sval.NumField(); i++ {
-		field := stype.Field(i)
-		if field.PkgPath != "" {
+	for _, cf := range cachedFieldsFor(sval.Type(), tagname) {
+		if !cf.HasTag || cf.Skip {
 			continue
 		}
-		if tag, ok := field.Tag.Lookup(tagname); ok {
-			mapfield[tagHead(tag)] = field
+		mapfield[cf.TagHead] = cf.StructField
+	}
+}
+
+// Options configures the optional, non-strict behavior of FillStructOpts.
+// The zero value keeps the strict behavior of FillStruct/FillStructByTags,
+// which applies no weak coercion.
+type Options struct {
+	// WeaklyTyped enables best-effort coercion between compatible scalar
+	// kinds when the source value does not already match the destination
+	// field: string<->numeric, numeric<->bool (0/1), string->time.Time,
+	// and numeric widening/narrowing with overflow checks. A time.Time
+	// value is not coerced into a string field.
+	WeaklyTyped bool
+	// TagName is the struct tag consulted to locate fields, same as the
+	// tag argument of FillStructByTags. Leave empty to match by field name.
+	TagName string
+	// TimeLayouts is the ordered list of layouts tried when weakly coercing
+	// a string into a time.Time field. Defaults to []string{time.RFC3339}.
+	TimeLayouts []string
+}
+
+// CoercionError reports a field that FillStructOpts could not weakly
+// coerce, retaining the field name and the value that was attempted.
+type CoercionError struct {
+	Field string
+	Value interface{}
+	Err   error
+}
+
+func (e *CoercionError) Error() string {
+	return fmt.Sprintf("smapping: cannot coerce field %q from value %#v: %s", e.Field, e.Value, e.Err.Error())
+}
+
+func (e *CoercionError) Unwrap() error {
+	return e.Err
+}
+
+func weakTimeLayouts(opts *Options) []string {
+	if opts == nil || len(opts.TimeLayouts) == 0 {
+		return []string{time.RFC3339}
+	}
+	return opts.TimeLayouts
+}
+
+func coerceToTime(fieldType reflect.Type, str string, layouts []string) (reflect.Value, error) {
+	var lastErr error
+	for _, layout := range layouts {
+		t, err := time.Parse(layout, str)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if fieldType.Kind() == reflect.Ptr {
+			res := reflect.New(fieldType.Elem())
+			res.Elem().Set(reflect.ValueOf(t))
+			return res, nil
+		}
+		return reflect.ValueOf(t), nil
+	}
+	return reflect.Value{}, fmt.Errorf("no layout matched: %s", lastErr.Error())
+}
+
+func coerceToString(rValue reflect.Value) (reflect.Value, error) {
+	switch rValue.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return reflect.ValueOf(strconv.FormatInt(rValue.Int(), 10)), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return reflect.ValueOf(strconv.FormatUint(rValue.Uint(), 10)), nil
+	case reflect.Float32, reflect.Float64:
+		return reflect.ValueOf(strconv.FormatFloat(rValue.Float(), 'f', -1, 64)), nil
+	case reflect.Bool:
+		return reflect.ValueOf(strconv.FormatBool(rValue.Bool())), nil
+	}
+	return reflect.Value{}, fmt.Errorf("cannot coerce %s to string", rValue.Kind())
+}
+
+func coerceToBool(rValue reflect.Value) (reflect.Value, error) {
+	switch rValue.Kind() {
+	case reflect.String:
+		b, err := strconv.ParseBool(rValue.String())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(b), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n := rValue.Int()
+		if n != 0 && n != 1 {
+			return reflect.Value{}, fmt.Errorf("numeric value %d out of range for bool (must be 0 or 1)", n)
+		}
+		return reflect.ValueOf(n == 1), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n := rValue.Uint()
+		if n != 0 && n != 1 {
+			return reflect.Value{}, fmt.Errorf("numeric value %d out of range for bool (must be 0 or 1)", n)
+		}
+		return reflect.ValueOf(n == 1), nil
+	case reflect.Float32, reflect.Float64:
+		f := rValue.Float()
+		if f != 0 && f != 1 {
+			return reflect.Value{}, fmt.Errorf("numeric value %v out of range for bool (must be 0 or 1)", f)
+		}
+		return reflect.ValueOf(f == 1), nil
+	}
+	return reflect.Value{}, fmt.Errorf("cannot coerce %s to bool", rValue.Kind())
+}
+
+func coerceToInt(fieldType reflect.Type, rValue reflect.Value) (reflect.Value, error) {
+	var n int64
+	switch rValue.Kind() {
+	case reflect.String:
+		parsed, err := strconv.ParseInt(rValue.String(), 10, fieldType.Bits())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		n = parsed
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = rValue.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u := rValue.Uint()
+		if u > uint64(math.MaxInt64) {
+			return reflect.Value{}, fmt.Errorf("value %d overflows %s", u, fieldType)
+		}
+		n = int64(u)
+	case reflect.Float32, reflect.Float64:
+		n = int64(rValue.Float())
+	case reflect.Bool:
+		if rValue.Bool() {
+			n = 1
+		}
+	default:
+		return reflect.Value{}, fmt.Errorf("cannot coerce %s to %s", rValue.Kind(), fieldType)
+	}
+	result := reflect.New(fieldType).Elem()
+	if result.OverflowInt(n) {
+		return reflect.Value{}, fmt.Errorf("value %d overflows %s", n, fieldType)
+	}
+	result.SetInt(n)
+	return result, nil
+}
+
+func coerceToUint(fieldType reflect.Type, rValue reflect.Value) (reflect.Value, error) {
+	var n uint64
+	switch rValue.Kind() {
+	case reflect.String:
+		parsed, err := strconv.ParseUint(rValue.String(), 10, fieldType.Bits())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		n = parsed
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n = rValue.Uint()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i := rValue.Int()
+		if i < 0 {
+			return reflect.Value{}, fmt.Errorf("value %d overflows %s", i, fieldType)
+		}
+		n = uint64(i)
+	case reflect.Float32, reflect.Float64:
+		f := rValue.Float()
+		if f < 0 {
+			return reflect.Value{}, fmt.Errorf("value %v overflows %s", f, fieldType)
+		}
+		n = uint64(f)
+	case reflect.Bool:
+		if rValue.Bool() {
+			n = 1
 		}
+	default:
+		return reflect.Value{}, fmt.Errorf("cannot coerce %s to %s", rValue.Kind(), fieldType)
+	}
+	result := reflect.New(fieldType).Elem()
+	if result.OverflowUint(n) {
+		return reflect.Value{}, fmt.Errorf("value %d overflows %s", n, fieldType)
 	}
+	result.SetUint(n)
+	return result, nil
+}
+
+func coerceToFloat(fieldType reflect.Type, rValue reflect.Value) (reflect.Value, error) {
+	var f float64
+	switch rValue.Kind() {
+	case reflect.String:
+		parsed, err := strconv.ParseFloat(rValue.String(), fieldType.Bits())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		f = parsed
+	case reflect.Float32, reflect.Float64:
+		f = rValue.Float()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		f = float64(rValue.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		f = float64(rValue.Uint())
+	case reflect.Bool:
+		if rValue.Bool() {
+			f = 1
+		}
+	default:
+		return reflect.Value{}, fmt.Errorf("cannot coerce %s to %s", rValue.Kind(), fieldType)
+	}
+	result := reflect.New(fieldType).Elem()
+	if result.OverflowFloat(f) {
+		return reflect.Value{}, fmt.Errorf("value %v overflows %s", f, fieldType)
+	}
+	result.SetFloat(f)
+	return result, nil
+}
+
+// coerceWeaklyTyped attempts the per-kind scalar coercions described by
+// Options.WeaklyTyped, keyed off the destination field's reflect.Kind.
+func coerceWeaklyTyped(rField, rValue reflect.Value, opts *Options) (reflect.Value, error) {
+	if rField.Kind() == reflect.Ptr {
+		elemType := rField.Type().Elem()
+		elem, err := coerceWeaklyTyped(reflect.New(elemType).Elem(), rValue, opts)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		ptr := reflect.New(elemType)
+		ptr.Elem().Set(elem)
+		return ptr, nil
+	}
+	switch rField.Kind() {
+	case reflect.String:
+		return coerceToString(rValue)
+	case reflect.Bool:
+		return coerceToBool(rValue)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return coerceToInt(rField.Type(), rValue)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return coerceToUint(rField.Type(), rValue)
+	case reflect.Float32, reflect.Float64:
+		return coerceToFloat(rField.Type(), rValue)
+	}
+	return reflect.Value{}, fmt.Errorf("no weak coercion available for kind %s", rField.Kind())
 }
 
 func setFieldFromTag(obj interface{}, tagname, tagvalue string,
 	value interface{}, mapfield map[string]reflect.StructField) (bool, error) {
-	return SetFieldFromTag(obj, tagname, tagvalue, value, mapfield)
+	return setFieldFromTagOpts(obj, tagname, tagvalue, value, mapfield, nil)
 }
 
+// SetFieldFromTag sets a single field of obj named by tagValue (resolved
+// through tagName2structField when tagName is non-empty) to value. It
+// always uses the strict behavior of FillStruct/FillStructByTags, with no
+// weak coercion; use FillStructOpts for weakly-typed coercion.
 func SetFieldFromTag(
 	obj interface{},
 	tagName, tagValue string,
 	value interface{},
 	tagName2structField map[string]reflect.StructField,
+) (bool, error) {
+	return setFieldFromTagOpts(obj, tagName, tagValue, value, tagName2structField, nil)
+}
+
+func setFieldFromTagOpts(
+	obj interface{},
+	tagName, tagValue string,
+	value interface{},
+	tagName2structField map[string]reflect.StructField,
+	opts *Options,
 ) (bool, error) {
 	rObjVal := extractValue(obj)
 	rObjType := rObjVal.Type()
@@ -416,9 +1083,41 @@ func SetFieldFromTag(
 	rValueKind := rValue.Kind()
 	rValueType := rValue.Type()
 
+	if handled, err := defaultCodec.Decode(value, rField); handled {
+		if err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
 	lcFieldZeroValue := reflect.New(rFieldType).Elem()
+	isWeakNumericToString := rFieldKind == reflect.String &&
+		(rValueKind == reflect.Int || rValueKind == reflect.Int8 || rValueKind == reflect.Int16 || rValueKind == reflect.Int32 || rValueKind == reflect.Int64 ||
+			rValueKind == reflect.Uint || rValueKind == reflect.Uint8 || rValueKind == reflect.Uint16 || rValueKind == reflect.Uint32 || rValueKind == reflect.Uint64 ||
+			rValueKind == reflect.Float32 || rValueKind == reflect.Float64 || rValueKind == reflect.Bool)
+	isNumericKind := func(k reflect.Kind) bool {
+		return k >= reflect.Int && k <= reflect.Float64 && k != reflect.Uintptr
+	}
+	isWeakNumericToNumeric := isNumericKind(rFieldKind) && isNumericKind(rValueKind)
 	if rFieldType == rValueType {
 		// nothing
+	} else if opts != nil && opts.WeaklyTyped && isWeakNumericToNumeric {
+		// reflect's numeric Convert wraps silently on narrowing; go through
+		// the overflow-checked coercion instead.
+		coerced, err := coerceWeaklyTyped(rField, rValue, opts)
+		if err != nil {
+			return false, &CoercionError{Field: tagValue, Value: value, Err: err}
+		}
+		rValue = coerced
+	} else if opts != nil && opts.WeaklyTyped && isWeakNumericToString {
+		// Go's built-in numeric->string conversion (via CanConvert/Convert)
+		// treats the number as a rune code point, which is never what a
+		// weakly-typed decode wants; format it as text instead.
+		coerced, err := coerceToString(rValue)
+		if err != nil {
+			return false, &CoercionError{Field: tagValue, Value: value, Err: err}
+		}
+		rValue = coerced
 	} else if rValue.CanConvert(rFieldType) {
 		rValue = rValue.Convert(rFieldType)
 	} else if rFieldType.Implements(mapDecoderI) || reflect.PointerTo(rFieldType).Implements(mapDecoderI) {
@@ -441,10 +1140,31 @@ func SetFieldFromTag(
 		} else {
 			rValue = reflect.Indirect(reflect.ValueOf(mapdecoder))
 		}
+	} else if opts != nil && opts.WeaklyTyped && isTime(rField.Type()) && rValueKind == reflect.String {
+		coerced, err := coerceToTime(rFieldType, rValue.String(), weakTimeLayouts(opts))
+		if err != nil {
+			return false, &CoercionError{Field: tagValue, Value: value, Err: err}
+		}
+		rValue = coerced
 	} else if isTime(rField.Type()) {
 		if err := fillTime(rField, &rValue); err != nil {
 			return false, err
 		}
+	} else if isMapFieldDest(rFieldType) && (rValueType.Name() == "Mapped" || rValueType == reflect.TypeOf(map[string]interface{}{})) {
+		mapType := rFieldType
+		if mapType.Kind() == reflect.Ptr {
+			mapType = mapType.Elem()
+		}
+		decoded, err := decodeMapField(mapType, value, tagName)
+		if err != nil {
+			return false, &CoercionError{Field: tagValue, Value: value, Err: err}
+		}
+		if rFieldType.Kind() == reflect.Ptr {
+			ptr := reflect.New(mapType)
+			ptr.Elem().Set(decoded)
+			decoded = ptr
+		}
+		rValue = decoded
 	} else if lcFieldZeroValue.IsValid() && rValue.Type().Name() == "Mapped" {
 		if err := fillMapIter(rField, lcFieldZeroValue, &rValue, tagName); err != nil {
 			return false, err
@@ -465,6 +1185,12 @@ func SetFieldFromTag(
 		rValue = rValue.Elem()
 	} else if rFieldKind != reflect.Ptr && rValueKind == reflect.Ptr && rValue.Elem().CanConvert(rFieldType) {
 		rValue = rValue.Elem().Convert(rFieldType)
+	} else if opts != nil && opts.WeaklyTyped {
+		coerced, err := coerceWeaklyTyped(rField, rValue, opts)
+		if err != nil {
+			return false, &CoercionError{Field: tagValue, Value: value, Err: err}
+		}
+		rValue = coerced
 	} else if rFieldType != rValueType {
 		return false, fmt.Errorf("provided value (%#v) type %T not match field tag '%s' of tagname '%s'  of type '%v' from object",
 			value, value, tagName, tagValue, rFieldType)
@@ -524,6 +1250,38 @@ func FillStructByTags(obj interface{}, mapped Mapped, tagname string) error {
 	return nil
 }
 
+/*
+FillStructOpts behaves like FillStructByTags but applies the coercion and
+field-lookup behavior configured by opts. With a zero Options it is
+equivalent to FillStruct (opts.TagName == "") or FillStructByTags
+(opts.TagName != ""). Set opts.WeaklyTyped to accept compatible scalar
+values — e.g. numeric strings from form posts or YAML/INI/env sources —
+that would otherwise be rejected by the strict type check.
+*/
+func FillStructOpts(obj interface{}, mapped Mapped, opts Options) error {
+	errmsg := ""
+	mapf := make(map[string]reflect.StructField)
+	if opts.TagName != "" {
+		populateMapFieldsTag(mapf, opts.TagName, obj)
+	}
+	for k, v := range mapped {
+		if v == nil {
+			continue
+		}
+		_, err := setFieldFromTagOpts(obj, opts.TagName, k, v, mapf, &opts)
+		if err != nil {
+			if errmsg != "" {
+				errmsg += ","
+			}
+			errmsg += err.Error()
+		}
+	}
+	if errmsg != "" {
+		return fmt.Errorf(errmsg)
+	}
+	return nil
+}
+
 // FillStructDeflate fills the nested object from flat map.
 // This works by filling outer struct first and then checking its subsequent object fields.
 func FillStructDeflate(obj interface{}, mapped Mapped, tagname string) error {
@@ -615,14 +1373,14 @@ func assignScanner(mapvals []interface{}, tagFields map[string]reflect.StructFie
 		} else if strufield, ok := tagFields[key]; ok {
 			typof = strufield.Type
 		} else {
-			for i := 0; i < typof.NumField(); i++ {
-				strufield := typof.Field(i)
-				if tagval, ok := strufield.Tag.Lookup(tag); ok {
-					tagFields[key] = strufield
-					if tagHead(tagval) == key {
-						typof = strufield.Type
-						break
-					}
+			for _, cf := range cachedFieldsFor(typof, tag) {
+				if !cf.HasTag {
+					continue
+				}
+				tagFields[key] = cf.StructField
+				if cf.TagHead == key {
+					typof = cf.StructField.Type
+					break
 				}
 			}
 		}
@@ -684,13 +1442,10 @@ func assignValuer(mapres Mapped, tagFields map[string]reflect.StructField,
 		} else if strufield, ok := tagFields[key]; ok {
 			typof = strufield.Type
 		} else {
-			for i := 0; i < typof.NumField(); i++ {
-				strufield := typof.Field(i)
-				if tagval, ok := strufield.Tag.Lookup(tag); ok {
-					if tagHead(tagval) == key {
-						typof = strufield.Type
-						break
-					}
+			for _, cf := range cachedFieldsFor(typof, tag) {
+				if cf.HasTag && cf.TagHead == key {
+					typof = cf.StructField.Type
+					break
 				}
 			}
 		}
@@ -723,19 +1478,13 @@ func SQLScan(row SQLScanner, obj interface{}, tag string, x ...string) error {
 	length := len(x)
 	if length == 0 || (length == 1 && x[0] == "*") {
 		typof := reflect.TypeOf(obj).Elem()
-		newfields := make([]string, typof.NumField())
-		length = typof.NumField()
-		for i := 0; i < length; i++ {
-			field := typof.Field(i)
-			if tag == "" {
-				newfields[i] = field.Name
-			} else {
-				if tagval, ok := field.Tag.Lookup(tag); ok {
-					newfields[i] = tagHead(tagval)
-				}
-			}
+		cached := cachedFieldsFor(typof, tag)
+		newfields := make([]string, len(cached))
+		for i, cf := range cached {
+			newfields[i] = cf.TagHead
 		}
 		fieldsName = newfields
+		length = len(newfields)
 	}
 	mapvals := make([]interface{}, length)
 	tagFields := make(map[string]reflect.StructField)
@@ -756,3 +1505,101 @@ func SQLScan(row SQLScanner, obj interface{}, tag string, x ...string) error {
 	}
 	return err
 }
+
+/*
+SQLScanRows scans every remaining row of rows into a new element appended
+to *slicePtr, which must point to a []T or []*T where T is a struct.
+Scan targets are derived from rows.Columns(), matching each column against
+a field's tag head and, failing that, its field name; columns that match
+neither are scanned into a throwaway destination and skipped. Allocation
+and type coercion reuse the same assignScanner/assignValuer plumbing as
+SQLScan.
+*/
+func SQLScanRows(rows *sql.Rows, slicePtr interface{}, tag string) error {
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	sliceVal := reflect.ValueOf(slicePtr)
+	if sliceVal.Kind() != reflect.Ptr || sliceVal.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("smapping: SQLScanRows requires a pointer to a slice, got %T", slicePtr)
+	}
+	sliceElem := sliceVal.Elem()
+	elemType := sliceElem.Type().Elem()
+	isPtrElem := elemType.Kind() == reflect.Ptr
+	structType := elemType
+	if isPtrElem {
+		structType = elemType.Elem()
+	}
+	if structType.Kind() != reflect.Struct {
+		return fmt.Errorf("smapping: SQLScanRows requires a slice of struct or *struct, got %s", elemType)
+	}
+
+	byTagHead := make(map[string]cachedField)
+	byName := make(map[string]cachedField)
+	for _, cf := range cachedFieldsFor(structType, tag) {
+		if cf.Skip {
+			continue
+		}
+		if cf.HasTag {
+			byTagHead[cf.TagHead] = cf
+		}
+		byName[cf.Name] = cf
+	}
+	matches := make([]*cachedField, len(columns))
+	for i, col := range columns {
+		if cf, ok := byTagHead[col]; ok {
+			matches[i] = &cf
+		} else if cf, ok := byName[col]; ok {
+			matches[i] = &cf
+		}
+	}
+
+	for rows.Next() {
+		elemPtr := reflect.New(structType)
+		obj := elemPtr.Interface()
+
+		tagFields := make(map[string]reflect.StructField)
+		mapvals := make([]interface{}, len(columns))
+		for i, cf := range matches {
+			if cf == nil {
+				var ignored interface{}
+				mapvals[i] = &ignored
+				continue
+			}
+			zero := reflect.Zero(cf.StructField.Type).Interface()
+			assignScanner(mapvals, tagFields, tag, i, matchKey(cf), obj, zero)
+		}
+		if err := rows.Scan(mapvals...); err != nil {
+			return err
+		}
+		rowResult := make(Mapped)
+		for i, cf := range matches {
+			if cf == nil {
+				continue
+			}
+			key := matchKey(cf)
+			assignValuer(rowResult, tagFields, tag, key, obj, mapvals[i])
+			if _, err := SetFieldFromTag(obj, "", cf.Name, rowResult[key], nil); err != nil {
+				return err
+			}
+		}
+
+		if isPtrElem {
+			sliceElem.Set(reflect.Append(sliceElem, elemPtr))
+		} else {
+			sliceElem.Set(reflect.Append(sliceElem, elemPtr.Elem()))
+		}
+	}
+	return rows.Err()
+}
+
+// matchKey is the lookup key SQLScanRows uses for a matched column: its
+// tag head when tagged, otherwise its field name.
+func matchKey(cf *cachedField) string {
+	if cf.HasTag {
+		return cf.TagHead
+	}
+	return cf.Name
+}
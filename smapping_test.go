@@ -0,0 +1,405 @@
+package smapping
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// -- weakly-typed coercion --
+
+type weakTarget struct {
+	Age     int       `json:"age"`
+	Active  bool      `json:"active"`
+	Label   string    `json:"label"`
+	Created time.Time `json:"created"`
+	Limit   *int      `json:"limit"`
+}
+
+func TestFillStructOptsWeaklyTyped(t *testing.T) {
+	var dst weakTarget
+	err := FillStructOpts(&dst, Mapped{
+		"age":     "42",
+		"active":  1,
+		"label":   99,
+		"created": "2020-01-02T03:04:05Z",
+		"limit":   "7",
+	}, Options{WeaklyTyped: true, TagName: "json"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dst.Age != 42 {
+		t.Errorf("Age = %d, want 42", dst.Age)
+	}
+	if !dst.Active {
+		t.Errorf("Active = false, want true")
+	}
+	if dst.Label != "99" {
+		t.Errorf("Label = %q, want %q", dst.Label, "99")
+	}
+	if dst.Created.Year() != 2020 {
+		t.Errorf("Created = %v, want year 2020", dst.Created)
+	}
+	if dst.Limit == nil || *dst.Limit != 7 {
+		t.Errorf("Limit = %v, want pointer to 7", dst.Limit)
+	}
+}
+
+func TestFillStructOptsStrictRejectsMismatch(t *testing.T) {
+	var dst weakTarget
+	err := FillStructOpts(&dst, Mapped{"age": "42"}, Options{TagName: "json"})
+	if err == nil {
+		t.Fatalf("expected strict mode to reject a string for an int field")
+	}
+}
+
+// -- map[string]T destination fields --
+
+type profile struct {
+	Nickname string `json:"nickname"`
+}
+
+type withProfiles struct {
+	Profiles map[string]profile `json:"profiles"`
+	Scores   map[string]int     `json:"scores"`
+}
+
+func TestFillStructByTagsMapField(t *testing.T) {
+	var dst withProfiles
+	err := FillStructByTags(&dst, Mapped{
+		"profiles": Mapped{
+			"alice": Mapped{"nickname": "al"},
+		},
+		"scores": Mapped{"alice": 10, "bob": 20},
+	}, "json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dst.Profiles["alice"].Nickname != "al" {
+		t.Errorf("Profiles[alice].Nickname = %q, want %q", dst.Profiles["alice"].Nickname, "al")
+	}
+	if dst.Scores["alice"] != 10 || dst.Scores["bob"] != 20 {
+		t.Errorf("Scores = %+v, want map[alice:10 bob:20]", dst.Scores)
+	}
+}
+
+// -- codec registry --
+
+type celsius float64
+
+func TestCodecRegistry(t *testing.T) {
+	codec := NewCodec()
+	celsiusType := reflect.TypeOf(celsius(0))
+	codec.RegisterTypeEncoder(celsiusType, func(v reflect.Value) (interface{}, error) {
+		return v.Float()*9/5 + 32, nil
+	})
+	codec.RegisterTypeDecoder(celsiusType, func(raw interface{}, target reflect.Value) error {
+		f, ok := raw.(float64)
+		if !ok {
+			return errors.New("expected float64")
+		}
+		target.SetFloat((f - 32) * 5 / 9)
+		return nil
+	})
+
+	encoded, handled, err := codec.Encode(reflect.ValueOf(celsius(100)))
+	if err != nil {
+		t.Fatalf("Encode error: %v", err)
+	}
+	if !handled {
+		t.Fatalf("Encode did not report the registered encoder as handled")
+	}
+	if encoded.(float64) != 212 {
+		t.Errorf("Encode(100C) = %v, want 212", encoded)
+	}
+
+	var decoded celsius
+	handled, err = codec.Decode(212.0, reflect.ValueOf(&decoded).Elem())
+	if err != nil {
+		t.Fatalf("Decode error: %v", err)
+	}
+	if !handled {
+		t.Fatalf("Decode did not report the registered decoder as handled")
+	}
+	if decoded != 100 {
+		t.Errorf("Decode(212F) = %v, want 100", decoded)
+	}
+}
+
+// -- dotted-path flatten/inflate --
+
+type address struct {
+	City string `json:"city"`
+}
+
+type user struct {
+	Address address `json:"address"`
+}
+
+type withUser struct {
+	User user `json:"user"`
+}
+
+func TestMapTagsFlattenInflateRoundTrip(t *testing.T) {
+	src := withUser{User: user{Address: address{City: "NYC"}}}
+	flat, err := MapTagsFlattenOpts(src, "json", FlattenOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if flat["user.address.city"] != "NYC" {
+		t.Fatalf("flat = %+v, want key user.address.city = NYC", flat)
+	}
+
+	var dst withUser
+	if err := FillStructInflateOpts(&dst, flat, "json", FlattenOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dst.User.Address.City != "NYC" {
+		t.Errorf("dst.User.Address.City = %q, want %q", dst.User.Address.City, "NYC")
+	}
+}
+
+func TestMapTagsFlattenMaxDepthErrors(t *testing.T) {
+	src := withUser{User: user{Address: address{City: "NYC"}}}
+	if _, err := MapTagsFlattenOpts(src, "json", FlattenOptions{MaxDepth: 1}); err == nil {
+		t.Fatalf("expected error when nesting exceeds MaxDepth")
+	}
+	if err := FillStructInflateOpts(&withUser{}, Mapped{"user.address.city": "NYC"}, "json", FlattenOptions{MaxDepth: 1}); err == nil {
+		t.Fatalf("expected error when flat key exceeds MaxDepth")
+	}
+}
+
+type withTime struct {
+	Created time.Time `json:"created"`
+}
+
+func TestMapTagsFlattenTimeLeaf(t *testing.T) {
+	src := withTime{Created: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)}
+	flat, err := MapTagsFlattenOpts(src, "json", FlattenOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	created, ok := flat["created"]
+	if !ok {
+		t.Fatalf("flat = %+v, want key 'created' present", flat)
+	}
+	if got, ok := created.(time.Time); !ok || !got.Equal(src.Created) {
+		t.Errorf("flat[created] = %v, want %v", created, src.Created)
+	}
+
+	var dst withTime
+	if err := FillStructInflateOpts(&dst, flat, "json", FlattenOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !dst.Created.Equal(src.Created) {
+		t.Errorf("dst.Created = %v, want %v", dst.Created, src.Created)
+	}
+}
+
+// -- reflection cache --
+
+type cached struct {
+	Name string `json:"name"`
+}
+
+func TestClearCacheConcurrentSafe(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			MapTags(cached{Name: "a"}, "json")
+		}()
+		go func() {
+			defer wg.Done()
+			ClearCache()
+		}()
+	}
+	wg.Wait()
+
+	ClearCache()
+	m := MapTags(cached{Name: "b"}, "json")
+	if m["name"] != "b" {
+		t.Fatalf("MapTags after ClearCache = %+v, want name=b", m)
+	}
+}
+
+// -- SQLScanRows --
+
+type fakeDriver struct{}
+type fakeConn struct{}
+type fakeStmt struct{ query string }
+type fakeRows struct {
+	cols []string
+	rows [][]driver.Value
+	pos  int
+}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) { return fakeConn{}, nil }
+func (fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{query: query}, nil
+}
+func (fakeConn) Close() error              { return nil }
+func (fakeConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &fakeRows{
+		cols: []string{"name", "age"},
+		rows: [][]driver.Value{
+			{"alice", int64(30)},
+			{"bob", int64(40)},
+		},
+	}, nil
+}
+
+func (r *fakeRows) Columns() []string { return r.cols }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.pos])
+	r.pos++
+	return nil
+}
+
+type person struct {
+	Name string `json:"name"`
+	Age  int    `json:"age"`
+}
+
+func TestSQLScanRows(t *testing.T) {
+	sql.Register("smapping-fake-driver", fakeDriver{})
+	db, err := sql.Open("smapping-fake-driver", "")
+	if err != nil {
+		t.Fatalf("sql.Open error: %v", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query("select name, age from people")
+	if err != nil {
+		t.Fatalf("Query error: %v", err)
+	}
+	defer rows.Close()
+
+	var people []person
+	if err := SQLScanRows(rows, &people, "json"); err != nil {
+		t.Fatalf("SQLScanRows error: %v", err)
+	}
+	if len(people) != 2 {
+		t.Fatalf("len(people) = %d, want 2", len(people))
+	}
+	if people[0].Name != "alice" || people[0].Age != 30 {
+		t.Errorf("people[0] = %+v, want {alice 30}", people[0])
+	}
+	if people[1].Name != "bob" || people[1].Age != 40 {
+		t.Errorf("people[1] = %+v, want {bob 40}", people[1])
+	}
+}
+
+type withHidden struct {
+	Name   string `json:"name"`
+	Hidden string `json:"-"`
+}
+
+type fakeHiddenStmt struct{}
+
+func (fakeHiddenStmt) Close() error  { return nil }
+func (fakeHiddenStmt) NumInput() int { return -1 }
+func (fakeHiddenStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+func (fakeHiddenStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &fakeRows{
+		cols: []string{"name", "Hidden"},
+		rows: [][]driver.Value{
+			{"alice", "leaked"},
+		},
+	}, nil
+}
+
+type fakeHiddenConn struct{}
+
+func (fakeHiddenConn) Prepare(query string) (driver.Stmt, error) { return fakeHiddenStmt{}, nil }
+func (fakeHiddenConn) Close() error                              { return nil }
+func (fakeHiddenConn) Begin() (driver.Tx, error)                 { return nil, errors.New("not supported") }
+
+type fakeHiddenDriver struct{}
+
+func (fakeHiddenDriver) Open(name string) (driver.Conn, error) { return fakeHiddenConn{}, nil }
+
+// TestSQLScanRowsSkipsDashTaggedField guards against a column whose name
+// happens to match the Go field name of a `json:"-"` field (here "Hidden")
+// being scanned into that field despite the tag marking it skipped.
+func TestSQLScanRowsSkipsDashTaggedField(t *testing.T) {
+	sql.Register("smapping-fake-hidden-driver", fakeHiddenDriver{})
+	db, err := sql.Open("smapping-fake-hidden-driver", "")
+	if err != nil {
+		t.Fatalf("sql.Open error: %v", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query("select name, Hidden from people")
+	if err != nil {
+		t.Fatalf("Query error: %v", err)
+	}
+	defer rows.Close()
+
+	var people []withHidden
+	if err := SQLScanRows(rows, &people, "json"); err != nil {
+		t.Fatalf("SQLScanRows error: %v", err)
+	}
+	if len(people) != 1 {
+		t.Fatalf("len(people) = %d, want 1", len(people))
+	}
+	if people[0].Hidden != "" {
+		t.Errorf("Hidden = %q, want empty since the field is tagged \"-\"", people[0].Hidden)
+	}
+}
+
+// -- omitempty and skip tag semantics --
+
+type secret struct {
+	Public string `json:"public"`
+	Hidden string `json:"-"`
+	Opt    string `json:"opt,omitempty"`
+}
+
+func TestMapTagsOmitEmptyAndSkip(t *testing.T) {
+	zero := MapTags(secret{Public: "x", Hidden: "y"}, "json")
+	if _, ok := zero["Hidden"]; ok {
+		t.Errorf("Hidden leaked into output: %+v", zero)
+	}
+	if _, ok := zero["-"]; ok {
+		t.Errorf("dash key leaked into output: %+v", zero)
+	}
+	if _, ok := zero["opt"]; ok {
+		t.Errorf("omitempty field present for zero value: %+v", zero)
+	}
+
+	nonZero := MapTags(secret{Public: "x", Opt: "present"}, "json")
+	if nonZero["opt"] != "present" {
+		t.Errorf("opt = %v, want present", nonZero["opt"])
+	}
+
+	var dst secret
+	if err := FillStructByTags(&dst, Mapped{"public": "z", "-": "nope", "opt": "o"}, "json"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dst.Public != "z" || dst.Opt != "o" {
+		t.Errorf("dst = %+v, want Public=z Opt=o", dst)
+	}
+	if dst.Hidden != "" {
+		t.Errorf("Hidden = %q, want empty since the field is tagged \"-\"", dst.Hidden)
+	}
+}